@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cgroupSamples holds the latest sample for each container being tracked,
+// keyed by container ID. In practice there is only ever one (-cgroup
+// selects a single container), but a map keeps the JSON shape consistent
+// with disk and leaves room for tracking more than one in future.
+var cgroupSamples sync.Map // cid string -> *atomic.Value
+
+func loadCgroupSamples() map[string]interface{} {
+	result := make(map[string]interface{})
+	cgroupSamples.Range(func(key, value interface{}) bool {
+		if s := value.(*atomic.Value).Load(); s != nil {
+			result[key.(string)] = s
+		}
+		return true
+	})
+	return result
+}
+
+// cgroupStats holds the accounting figures read for one container, whether
+// sourced from a cgroup v1 hierarchy or the cgroup v2 unified hierarchy.
+type cgroupStats struct {
+	Timestamp        time.Time
+	CPUUsageNanos    int64
+	MemoryUsageBytes int64
+	BlkioReadBytes   int64
+	BlkioWriteBytes  int64
+}
+
+// startCgroupCollector resolves cgroup to a container ID (waiting for a
+// CID file to appear if cgroup names one), locates its cgroup directories
+// under cgroupRoot, and runs a Collector reporting its accounting figures.
+// It is meant to be run in its own goroutine: resolution can block
+// indefinitely while the container has not yet started.
+func startCgroupCollector(cgroup, cgroupRoot string) {
+	cid, err := resolveCID(cgroup)
+	if err != nil {
+		log.Printf("cgroup: %v", err)
+		return
+	}
+
+	cc, err := newCgroupCollector(cgroupRoot, cid)
+	if err != nil {
+		log.Printf("cgroup: %v", err)
+		return
+	}
+
+	value := new(atomic.Value)
+	cgroupSamples.Store(cid, value)
+	runCollector("cgroup:"+cid, cc, value)
+}
+
+// resolveCID treats cgroup as a literal container ID unless it names a
+// path (absolute, or starting with "./"), in which case it is a CID file
+// as written by `docker run --cidfile`: wait for the file to be created,
+// then read the ID from it.
+func resolveCID(cgroup string) (string, error) {
+	if !strings.HasPrefix(cgroup, "/") && !strings.HasPrefix(cgroup, "./") {
+		return cgroup, nil
+	}
+
+	for {
+		b, err := os.ReadFile(cgroup)
+		if err == nil {
+			return strings.TrimSpace(string(b)), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// cgroupCollector implements Collector for a single container's cgroup.
+type cgroupCollector struct {
+	root string
+	cid  string
+	v2   bool
+
+	// Resolved lazily on first successful read and then cached, since the
+	// directory layout doesn't change for the lifetime of a container.
+	cpuDir    string
+	memoryDir string
+	blkioDir  string
+}
+
+func newCgroupCollector(root, cid string) (*cgroupCollector, error) {
+	_, err := os.Stat(filepath.Join(root, "cgroup.controllers"))
+	v2 := err == nil
+	return &cgroupCollector{root: root, cid: cid, v2: v2}, nil
+}
+
+func (c *cgroupCollector) Collect() (interface{}, error) {
+	if c.v2 {
+		return c.collectV2()
+	}
+	return c.collectV1()
+}
+
+func (c *cgroupCollector) collectV2() (interface{}, error) {
+	if c.cpuDir == "" {
+		dir, err := findCgroupDir(c.root, c.cid)
+		if err != nil {
+			return nil, err
+		}
+		c.cpuDir, c.memoryDir, c.blkioDir = dir, dir, dir
+	}
+
+	stats := cgroupStats{Timestamp: time.Now()}
+
+	if usage, err := readKeyedStatField(filepath.Join(c.cpuDir, "cpu.stat"), "usage_usec"); err == nil {
+		stats.CPUUsageNanos = usage * 1000
+	}
+	if v, err := readIntFile(filepath.Join(c.memoryDir, "memory.current")); err == nil {
+		stats.MemoryUsageBytes = v
+	}
+	if r, w, err := readIOStatTotals(filepath.Join(c.blkioDir, "io.stat")); err == nil {
+		stats.BlkioReadBytes, stats.BlkioWriteBytes = r, w
+	}
+
+	return stats, nil
+}
+
+func (c *cgroupCollector) collectV1() (interface{}, error) {
+	stats := cgroupStats{Timestamp: time.Now()}
+
+	if c.cpuDir == "" {
+		dir, err := findCgroupDir(filepath.Join(c.root, "cpuacct"), c.cid)
+		if err == nil {
+			c.cpuDir = dir
+		}
+	}
+	if c.cpuDir != "" {
+		if v, err := readIntFile(filepath.Join(c.cpuDir, "cpuacct.usage")); err == nil {
+			stats.CPUUsageNanos = v
+		}
+	}
+
+	if c.memoryDir == "" {
+		dir, err := findCgroupDir(filepath.Join(c.root, "memory"), c.cid)
+		if err == nil {
+			c.memoryDir = dir
+		}
+	}
+	if c.memoryDir != "" {
+		if v, err := readIntFile(filepath.Join(c.memoryDir, "memory.usage_in_bytes")); err == nil {
+			stats.MemoryUsageBytes = v
+		}
+	}
+
+	if c.blkioDir == "" {
+		dir, err := findCgroupDir(filepath.Join(c.root, "blkio"), c.cid)
+		if err == nil {
+			c.blkioDir = dir
+		}
+	}
+	if c.blkioDir != "" {
+		if r, w, err := readBlkioServiceBytes(filepath.Join(c.blkioDir, "blkio.io_service_bytes")); err == nil {
+			stats.BlkioReadBytes, stats.BlkioWriteBytes = r, w
+		}
+	}
+
+	if c.cpuDir == "" && c.memoryDir == "" && c.blkioDir == "" {
+		return nil, fmt.Errorf("cgroup:%s: no cpuacct, memory or blkio hierarchy found under %s", c.cid, c.root)
+	}
+
+	return stats, nil
+}
+
+// findCgroupDir searches under root for the single directory whose name
+// begins with cid, which is how container runtimes such as Docker and
+// containerd name per-container cgroups.
+func findCgroupDir(root, cid string) (string, error) {
+	var found string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // skip unreadable entries rather than aborting the walk
+		}
+		if found != "" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() && strings.HasPrefix(d.Name(), cid) {
+			found = path
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if found == "" {
+		return "", os.ErrNotExist
+	}
+	return found, nil
+}
+
+func readIntFile(path string) (int64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// readKeyedStatField reads a file of "key value" lines (cgroup v2's
+// cpu.stat, memory.stat, etc.) and returns the value for key.
+func readKeyedStatField(path, key string) (int64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	return 0, os.ErrNotExist
+}
+
+// readIOStatTotals sums the rbytes/wbytes fields of cgroup v2's io.stat
+// across all devices listed.
+func readIOStatTotals(path string) (readBytes, writeBytes int64, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		for _, field := range strings.Fields(line) {
+			k, v, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				continue
+			}
+			switch k {
+			case "rbytes":
+				readBytes += n
+			case "wbytes":
+				writeBytes += n
+			}
+		}
+	}
+	return readBytes, writeBytes, nil
+}
+
+// readBlkioServiceBytes sums the Read/Write lines of cgroup v1's
+// blkio.io_service_bytes across all devices listed.
+func readBlkioServiceBytes(path string) (readBytes, writeBytes int64, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[1] {
+		case "Read":
+			readBytes += n
+		case "Write":
+			writeBytes += n
+		}
+	}
+	return readBytes, writeBytes, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindCgroupDirMatchesByPrefix(t *testing.T) {
+	root := t.TempDir()
+	want := filepath.Join(root, "docker-abc123def.scope")
+	if err := os.MkdirAll(want, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "docker-other.scope"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := findCgroupDir(root, "docker-abc123def")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("findCgroupDir() = %q, want %q", got, want)
+	}
+}
+
+func TestFindCgroupDirNotFound(t *testing.T) {
+	root := t.TempDir()
+	if _, err := findCgroupDir(root, "nosuchcid"); !os.IsNotExist(err) {
+		t.Fatalf("findCgroupDir() err = %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestReadKeyedStatField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpu.stat")
+	writeTestFile(t, path, "usage_usec 123456\nuser_usec 100000\nsystem_usec 23456\n")
+
+	got, err := readKeyedStatField(path, "usage_usec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 123456 {
+		t.Fatalf("readKeyedStatField() = %d, want 123456", got)
+	}
+
+	if _, err := readKeyedStatField(path, "missing_key"); err == nil {
+		t.Fatal("expected error for missing key, got nil")
+	}
+}
+
+func TestReadIOStatTotals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "io.stat")
+	writeTestFile(t, path, "8:0 rbytes=1000 wbytes=2000 rios=10 wios=20\n8:16 rbytes=500 wbytes=250\n")
+
+	r, w, err := readIOStatTotals(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != 1500 || w != 2250 {
+		t.Fatalf("readIOStatTotals() = (%d, %d), want (1500, 2250)", r, w)
+	}
+}
+
+func TestReadBlkioServiceBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blkio.io_service_bytes")
+	writeTestFile(t, path, "8:0 Read 1024\n8:0 Write 2048\n8:0 Sync 3072\n8:0 Total 3072\n")
+
+	r, w, err := readBlkioServiceBytes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != 1024 || w != 2048 {
+		t.Fatalf("readBlkioServiceBytes() = (%d, %d), want (1024, 2048)", r, w)
+	}
+}
+
+// A v1 container whose cid matches none of the cpuacct/memory/blkio
+// hierarchies must return an error rather than a silent all-zero sample.
+func TestCollectV1ErrorsWhenNoHierarchyFound(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "cpuacct"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &cgroupCollector{root: root, cid: "nosuchcontainer"}
+	_, err := c.collectV1()
+	if err == nil {
+		t.Fatal("collectV1() err = nil, want an error when no hierarchy matches the cid")
+	}
+}
+
+func TestCollectV1ReadsAvailableHierarchies(t *testing.T) {
+	root := t.TempDir()
+	cid := "abc123"
+	writeTestFile(t, filepath.Join(root, "cpuacct", cid, "cpuacct.usage"), "42\n")
+
+	c := &cgroupCollector{root: root, cid: cid}
+	got, err := c.collectV1()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := got.(cgroupStats)
+	if stats.CPUUsageNanos != 42 {
+		t.Fatalf("CPUUsageNanos = %d, want 42", stats.CPUUsageNanos)
+	}
+}
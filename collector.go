@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Collector produces one fresh sample every time it is asked. Implementations
+// hold whatever previous-sample state they need to compute deltas (an open
+// file, the last set of counter values, and so on).
+type Collector interface {
+	// Collect returns the latest sample, or an error if one could not be
+	// obtained.
+	Collect() (interface{}, error)
+}
+
+// runCollector polls c every sampleInterval and stores each successful
+// sample in store. A failed collection is logged and retried on the next
+// tick rather than stopping the goroutine.
+func runCollector(name string, c Collector, store *atomic.Value) {
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		v, err := c.Collect()
+		if err != nil {
+			log.Printf("%s: %v", name, err)
+			continue
+		}
+		store.Store(v)
+	}
+}
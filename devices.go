@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultDeviceExclude skips the device-mapper, loopback and ramdisk
+// devices that normally show up under /sys/block but are rarely what
+// anyone wants in a dashboard.
+const defaultDeviceExclude = `^(loop|ram|dm-)`
+
+var (
+	deviceIncludeRe *regexp.Regexp
+	deviceExcludeRe *regexp.Regexp
+)
+
+// compileDeviceFilters compiles the -deviceInclude/-deviceExclude regexes
+// into deviceIncludeRe/deviceExcludeRe. It must be called once, after
+// flag.Parse, before discoverDevices is used.
+func compileDeviceFilters() {
+	if strings.TrimSpace(deviceInclude) != "" {
+		deviceIncludeRe = regexp.MustCompile(deviceInclude)
+	}
+	if strings.TrimSpace(deviceExclude) != "" {
+		deviceExcludeRe = regexp.MustCompile(deviceExclude)
+	}
+}
+
+// deviceState bundles the per-device state the rest of the server needs:
+// the latest sample, its ring-buffer history and latency histogram, and
+// the means to stop its collector goroutine when the device disappears.
+type deviceState struct {
+	value   *atomic.Value
+	history *ringBuffer
+	hist    *latencyHistogram
+	cancel  context.CancelFunc
+}
+
+// deviceRegistry is the set of currently-monitored block devices, keyed by
+// name. In -devices auto mode it is written to at runtime by the rescan
+// loop as devices come and go, so access goes through sync.Map rather
+// than a plain map guarded by a single mutex held for the process
+// lifetime.
+var deviceRegistry sync.Map // string -> *deviceState
+
+func deviceNames() []string {
+	var names []string
+	deviceRegistry.Range(func(k, _ interface{}) bool {
+		names = append(names, k.(string))
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
+func getDeviceState(name string) (*deviceState, bool) {
+	v, ok := deviceRegistry.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return v.(*deviceState), true
+}
+
+// startDevice begins monitoring device: it registers its deviceState and
+// launches its collector goroutine. It is idempotent, so the discovery
+// rescan loop can call it for every device it sees on every scan.
+//
+// The device is registered immediately, before its stat file has even been
+// opened successfully: a device named on the command line (or matched by
+// -devices auto) that is missing or briefly unreadable must still show up
+// in /healthz and the JSON endpoint as unhealthy, and still be listed in
+// /metrics, rather than silently vanishing from all three as if it were
+// never asked for.
+func startDevice(device string) {
+	if _, exists := getDeviceState(device); exists {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	state := &deviceState{
+		value:   new(atomic.Value),
+		history: newRingBuffer(historySize),
+		hist:    newLatencyHistogram(latencyHistogramWindow),
+		cancel:  cancel,
+	}
+	deviceRegistry.Store(device, state)
+	go openAndRunDiskCollector(ctx, device, state)
+}
+
+// openAndRunDiskCollector retries opening device's stat file every
+// sampleInterval until it succeeds or ctx is cancelled, recording the
+// failure on state after each attempt so an unopenable device is reported
+// as unhealthy rather than unmonitored. Once opened, it runs the device's
+// collector for the rest of its life.
+func openAndRunDiskCollector(ctx context.Context, device string, state *deviceState) {
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+
+	for {
+		dc, err := newDiskCollector(device, state.hist)
+		if err == nil {
+			runDiskCollector(ctx, device, dc, state.value, state.history, hub)
+			return
+		}
+
+		log.Printf("disk:%s: %v", device, err)
+		state.value.Store(ioStats{Healthy: false, LastError: err.Error()})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stopDevice stops monitoring a device that has disappeared: it cancels
+// its collector goroutine and removes it from the registry.
+func stopDevice(device string) {
+	if state, ok := getDeviceState(device); ok {
+		state.cancel()
+		deviceRegistry.Delete(device)
+	}
+}
+
+// discoverDevices enumerates /sys/block, applying the include/exclude
+// filters, and returns the matching device names.
+func discoverDevices(sysBlockRoot string) ([]string, error) {
+	entries, err := os.ReadDir(sysBlockRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if deviceExcludeRe != nil && deviceExcludeRe.MatchString(name) {
+			continue
+		}
+		if deviceIncludeRe != nil && !deviceIncludeRe.MatchString(name) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(sysBlockRoot, name, "stat")); err != nil {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// runDeviceDiscovery enumerates devices immediately and then every
+// rescanInterval afterwards, starting collectors for newly-appeared
+// devices and stopping them for devices that have disappeared (USB
+// drives unplugged, NVMe hot-removed, LVs removed) so neither requires a
+// restart.
+func runDeviceDiscovery(rescanInterval time.Duration) {
+	scan := func() {
+		names, err := discoverDevices("/sys/block")
+		if err != nil {
+			log.Printf("device discovery: %v", err)
+			return
+		}
+
+		seen := make(map[string]bool, len(names))
+		for _, name := range names {
+			seen[name] = true
+			startDevice(name)
+		}
+
+		deviceRegistry.Range(func(k, _ interface{}) bool {
+			name := k.(string)
+			if !seen[name] {
+				stopDevice(name)
+			}
+			return true
+		})
+	}
+
+	scan()
+	ticker := time.NewTicker(rescanInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		scan()
+	}
+}
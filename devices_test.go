@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+// withDeviceFilters sets deviceIncludeRe/deviceExcludeRe for the duration of
+// the test and restores the previous values (in particular nil) afterwards,
+// since they are package globals shared with compileDeviceFilters.
+func withDeviceFilters(t *testing.T, include, exclude string) {
+	t.Helper()
+	prevInclude, prevExclude := deviceIncludeRe, deviceExcludeRe
+	t.Cleanup(func() { deviceIncludeRe, deviceExcludeRe = prevInclude, prevExclude })
+
+	deviceIncludeRe = nil
+	if include != "" {
+		deviceIncludeRe = regexp.MustCompile(include)
+	}
+	deviceExcludeRe = nil
+	if exclude != "" {
+		deviceExcludeRe = regexp.MustCompile(exclude)
+	}
+}
+
+func makeFakeSysBlock(t *testing.T, devices ...string) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, dev := range devices {
+		dir := filepath.Join(root, dev)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "stat"), []byte("0 0 0 0 0 0 0 0 0 0 0\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestDiscoverDevicesDefaultExcludesLoopRamDM(t *testing.T) {
+	withDeviceFilters(t, "", defaultDeviceExclude)
+	root := makeFakeSysBlock(t, "sda", "sdb", "loop0", "ram0", "dm-0", "nvme0n1")
+
+	got, err := discoverDevices(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+
+	want := []string{"nvme0n1", "sda", "sdb"}
+	if !equalStrings(got, want) {
+		t.Fatalf("discoverDevices() = %v, want %v", got, want)
+	}
+}
+
+func TestDiscoverDevicesIncludeFilter(t *testing.T) {
+	withDeviceFilters(t, "^sd", "")
+	root := makeFakeSysBlock(t, "sda", "sdb", "nvme0n1")
+
+	got, err := discoverDevices(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+
+	want := []string{"sda", "sdb"}
+	if !equalStrings(got, want) {
+		t.Fatalf("discoverDevices() = %v, want %v", got, want)
+	}
+}
+
+func TestDiscoverDevicesSkipsEntriesWithoutStatFile(t *testing.T) {
+	withDeviceFilters(t, "", "")
+	root := makeFakeSysBlock(t, "sda")
+	if err := os.MkdirAll(filepath.Join(root, "notadevice"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := discoverDevices(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"sda"}
+	if !equalStrings(got, want) {
+		t.Fatalf("discoverDevices() = %v, want %v", got, want)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// healthzHandler reports 503 if any monitored device is unhealthy (its
+// last collection attempt failed) or stale (no fresh sample within
+// 3*sampleInterval), so the process can sit behind a load balancer or be
+// used as a Kubernetes liveness/readiness probe.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	staleAfter := 3 * sampleInterval
+	now := time.Now()
+
+	var problems []string
+	for _, name := range deviceNames() {
+		state, ok := getDeviceState(name)
+		if !ok {
+			continue
+		}
+
+		v := state.value.Load()
+		if v == nil {
+			problems = append(problems, fmt.Sprintf("%s: no sample yet", name))
+			continue
+		}
+
+		s := v.(ioStats)
+		switch {
+		case !s.Healthy:
+			problems = append(problems, fmt.Sprintf("%s: %s", name, s.LastError))
+		case now.Sub(s.Timestamp) > staleAfter:
+			problems = append(problems, fmt.Sprintf("%s: stale, last sample at %s", name, s.Timestamp.Format(time.RFC3339)))
+		}
+	}
+
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, p := range problems {
+			fmt.Fprintln(w, p)
+		}
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
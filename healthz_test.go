@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// registerFakeDevice installs a deviceState holding sample directly in
+// deviceRegistry, bypassing startDevice's collector goroutine, and removes
+// it again once the test finishes.
+func registerFakeDevice(t *testing.T, name string, sample ioStats) {
+	t.Helper()
+	value := new(atomic.Value)
+	value.Store(sample)
+	deviceRegistry.Store(name, &deviceState{value: value, history: newRingBuffer(1), hist: newLatencyHistogram(latencyHistogramWindow)})
+	t.Cleanup(func() { deviceRegistry.Delete(name) })
+}
+
+func withSampleInterval(t *testing.T, d time.Duration) {
+	t.Helper()
+	prev := sampleInterval
+	sampleInterval = d
+	t.Cleanup(func() { sampleInterval = prev })
+}
+
+func TestHealthzOKWhenAllDevicesHealthy(t *testing.T) {
+	withSampleInterval(t, time.Second)
+	registerFakeDevice(t, "sda", ioStats{Timestamp: time.Now(), Healthy: true})
+
+	w := httptest.NewRecorder()
+	healthzHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	if w.Code != 200 {
+		t.Fatalf("status = %d, want 200; body: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHealthzServiceUnavailableWhenDeviceUnhealthy(t *testing.T) {
+	withSampleInterval(t, time.Second)
+	registerFakeDevice(t, "sda", ioStats{Timestamp: time.Now(), Healthy: false, LastError: "disk:sda: no such file or directory"})
+
+	w := httptest.NewRecorder()
+	healthzHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	if w.Code != 503 {
+		t.Fatalf("status = %d, want 503; body: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHealthzServiceUnavailableWhenDeviceStale(t *testing.T) {
+	withSampleInterval(t, time.Second)
+	registerFakeDevice(t, "sda", ioStats{Timestamp: time.Now().Add(-time.Hour), Healthy: true})
+
+	w := httptest.NewRecorder()
+	healthzHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	if w.Code != 503 {
+		t.Fatalf("status = %d, want 503; body: %s", w.Code, w.Body.String())
+	}
+}
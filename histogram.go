@@ -0,0 +1,170 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// histogramBuckets is the number of exponential buckets covering roughly
+// 1µs to 8.4s (1µs * 2^23), comfortably spanning the service latencies a
+// disk can produce.
+const histogramBuckets = 24
+
+// latencyBounds[i] is the inclusive upper bound of bucket i, in
+// nanoseconds: 1µs, 2µs, 4µs, ... doubling.
+var latencyBounds = computeLatencyBounds()
+
+func computeLatencyBounds() []int64 {
+	bounds := make([]int64, histogramBuckets)
+	b := int64(time.Microsecond)
+	for i := range bounds {
+		bounds[i] = b
+		b *= 2
+	}
+	return bounds
+}
+
+// latencyHistogram is a sliding-window, logarithmic-bucket histogram of
+// latency observations. It is implemented as a circular array of
+// per-second slots, so observations age out of the window a second at a
+// time rather than needing to be tracked individually.
+type latencyHistogram struct {
+	mu      sync.Mutex
+	window  int // seconds
+	buckets [][histogramBuckets]int64
+	sums    []int64 // total nanoseconds observed in each slot
+	counts  []int64
+	maxes   []int64 // largest single observation in each slot, in nanoseconds
+	curSlot int
+	curSec  int64
+}
+
+func newLatencyHistogram(window time.Duration) *latencyHistogram {
+	n := int(window / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	return &latencyHistogram{
+		window:  n,
+		buckets: make([][histogramBuckets]int64, n),
+		sums:    make([]int64, n),
+		counts:  make([]int64, n),
+		maxes:   make([]int64, n),
+	}
+}
+
+// Observe records a single latency observation at time now.
+func (h *latencyHistogram) Observe(now time.Time, latency time.Duration) {
+	if latency < 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.advance(now)
+
+	ns := int64(latency)
+	idx := sort.Search(histogramBuckets, func(i int) bool { return latencyBounds[i] >= ns })
+	// An observation above the largest bound goes in no bucket; it is still
+	// included in the count, sum and max (and so in Prometheus's +Inf bucket).
+	if idx < histogramBuckets {
+		h.buckets[h.curSlot][idx]++
+	}
+	h.sums[h.curSlot] += ns
+	h.counts[h.curSlot]++
+	if ns > h.maxes[h.curSlot] {
+		h.maxes[h.curSlot] = ns
+	}
+}
+
+// advance rotates the circular buffer forward to the slot for now,
+// clearing any slots the rotation skips over so they don't carry stale
+// counts forward.
+func (h *latencyHistogram) advance(now time.Time) {
+	sec := now.Unix()
+	if h.curSec == 0 {
+		h.curSec = sec
+		return
+	}
+	delta := sec - h.curSec
+	if delta <= 0 {
+		return
+	}
+	if delta > int64(h.window) {
+		delta = int64(h.window)
+	}
+	for i := int64(0); i < delta; i++ {
+		h.curSlot = (h.curSlot + 1) % h.window
+		h.buckets[h.curSlot] = [histogramBuckets]int64{}
+		h.sums[h.curSlot] = 0
+		h.counts[h.curSlot] = 0
+		h.maxes[h.curSlot] = 0
+	}
+	h.curSec = sec
+}
+
+// latencySnapshot is the histogram aggregated over its whole window, used
+// for both the JSON quantile fields and the Prometheus exposition.
+type latencySnapshot struct {
+	Count   int64
+	Sum     time.Duration
+	Buckets []int64 // cumulative count <= latencyBounds[i], parallel to latencyBounds
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+	Max     time.Duration
+}
+
+func (h *latencyHistogram) Snapshot(now time.Time) latencySnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.advance(now)
+
+	var perBucket [histogramBuckets]int64
+	var total, sum, max int64
+	for i := 0; i < h.window; i++ {
+		for b := 0; b < histogramBuckets; b++ {
+			perBucket[b] += h.buckets[i][b]
+		}
+		total += h.counts[i]
+		sum += h.sums[i]
+		if h.maxes[i] > max {
+			max = h.maxes[i]
+		}
+	}
+
+	cumulative := make([]int64, histogramBuckets)
+	var running int64
+	for i := 0; i < histogramBuckets; i++ {
+		running += perBucket[i]
+		cumulative[i] = running
+	}
+
+	return latencySnapshot{
+		Count:   total,
+		Sum:     time.Duration(sum),
+		Buckets: cumulative,
+		P50:     boundAtQuantile(cumulative, total, 0.50),
+		P90:     boundAtQuantile(cumulative, total, 0.90),
+		P99:     boundAtQuantile(cumulative, total, 0.99),
+		Max:     time.Duration(max),
+	}
+}
+
+// boundAtQuantile estimates the value at quantile q as the upper bound of
+// the first bucket whose cumulative count reaches q*total. Like
+// Prometheus's histogram_quantile, this over-estimates within a bucket's
+// range in exchange for not tracking individual observations.
+func boundAtQuantile(cumulative []int64, total int64, q float64) time.Duration {
+	if total == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(q * float64(total)))
+	for i, c := range cumulative {
+		if c >= target {
+			return time.Duration(latencyBounds[i])
+		}
+	}
+	return time.Duration(latencyBounds[len(latencyBounds)-1])
+}
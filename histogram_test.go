@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBoundAtQuantile(t *testing.T) {
+	cumulative := []int64{1, 3, 3, 10}
+
+	cases := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.10, time.Duration(latencyBounds[0])}, // target=1, first bucket reaching it
+		{0.50, time.Duration(latencyBounds[3])}, // target=5, bucket 1 (cum=3) isn't enough
+		{0.99, time.Duration(latencyBounds[3])}, // target=10
+	}
+	for _, c := range cases {
+		got := boundAtQuantile(cumulative, 10, c.q)
+		if got != c.want {
+			t.Errorf("boundAtQuantile(q=%v) = %v, want %v", c.q, got, c.want)
+		}
+	}
+
+	if got := boundAtQuantile(cumulative, 0, 0.5); got != 0 {
+		t.Errorf("boundAtQuantile with total=0 = %v, want 0", got)
+	}
+}
+
+func TestLatencyHistogramAggregatesWithinWindow(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0)
+	h := newLatencyHistogram(5 * time.Second)
+
+	h.Observe(base, 2*time.Millisecond)
+	h.Observe(base.Add(time.Second), 4*time.Millisecond)
+	h.Observe(base.Add(2*time.Second), 8*time.Millisecond)
+
+	snap := h.Snapshot(base.Add(2 * time.Second))
+	if snap.Count != 3 {
+		t.Fatalf("Count = %d, want 3", snap.Count)
+	}
+	if snap.Max != 8*time.Millisecond {
+		t.Fatalf("Max = %v, want %v (the raw largest observation)", snap.Max, 8*time.Millisecond)
+	}
+}
+
+func TestLatencyHistogramExpiresOldSlots(t *testing.T) {
+	base := time.Unix(1_700_000_000, 0)
+	h := newLatencyHistogram(2 * time.Second)
+
+	h.Observe(base, time.Millisecond)
+	// Advance well past the window: the first observation's slot should be
+	// reused and cleared rather than still counted.
+	h.Observe(base.Add(10*time.Second), 2*time.Millisecond)
+
+	snap := h.Snapshot(base.Add(10 * time.Second))
+	if snap.Count != 1 {
+		t.Fatalf("Count = %d, want 1 (old observation should have aged out)", snap.Count)
+	}
+	if snap.Max != 2*time.Millisecond {
+		t.Fatalf("Max = %v, want %v", snap.Max, 2*time.Millisecond)
+	}
+}
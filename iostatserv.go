@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -23,19 +24,68 @@ type ioStats struct {
 	WriteMillis        int64
 	InFlight           int64
 	WaitMillis         int64
+
+	// Cumulative counters, taken directly from the kernel's stat file rather
+	// than differentiated over sampleInterval, so that consumers such as
+	// Prometheus can compute rates over whatever window they choose.
+	Reads           int64
+	BytesRead       int64
+	ReadTicksMillis int64
+
+	Writes           int64
+	BytesWritten     int64
+	WriteTicksMillis int64
+
+	IoTicksMillis     int64
+	TimeInQueueMillis int64
+
+	// Average per-request service latency this sample, i.e. read_ticks/reads
+	// and write_ticks/writes, plus quantiles of those averages over the
+	// latencyHistogramWindow sliding window.
+	ReadLatencyAvgMillis  float64
+	WriteLatencyAvgMillis float64
+	LatencyP50Millis      float64
+	LatencyP90Millis      float64
+	LatencyP99Millis      float64
+	LatencyMaxMillis      float64
+
+	// Healthy is false when the most recent collection attempt failed (the
+	// device stat file was missing or unreadable, or its contents were
+	// malformed); the remaining fields then hold the last successfully
+	// collected sample rather than a fresh one. LastError describes the
+	// failure in that case.
+	Healthy   bool
+	LastError string `json:",omitempty"`
 }
 
+// latencyHistogramWindow is the width of the sliding window over which
+// LatencyP50Millis etc. are computed.
+const latencyHistogramWindow = 5 * time.Minute
+
 var (
-	lastSamples    = make(map[string]*atomic.Value)
 	sampleInterval time.Duration
 	httpPort       string
 	devices        string
+	deviceInclude  string
+	deviceExclude  string
+	deviceRescan   time.Duration
+	cgroup         string
+	cgroupRoot     string
+	historySize    int
+
+	hub = newStreamHub()
 )
 
 func main() {
 	flag.DurationVar(&sampleInterval, "sampleInterval", time.Second, "Sample interval")
 	flag.StringVar(&httpPort, "httpPort", ":8080", "HTTP Port to listen on")
-	flag.StringVar(&devices, "devices", "sda", "Comma-separated device names to report on")
+	flag.StringVar(&devices, "devices", "sda", `Comma-separated device names to report on, or "auto" to discover them from /sys/block`)
+	flag.StringVar(&deviceInclude, "deviceInclude", "", "Regex a device name must match to be included in -devices auto (default: all)")
+	flag.StringVar(&deviceExclude, "deviceExclude", defaultDeviceExclude, "Regex to exclude device names from -devices auto")
+	flag.DurationVar(&deviceRescan, "deviceRescan", 30*time.Second, "How often to re-scan for devices in -devices auto mode")
+	flag.StringVar(&cgroup, "cgroup", "", "Container ID, or path to a CID file, to report cgroup accounting for")
+	flag.StringVar(&cgroupRoot, "cgroupRoot", "/sys/fs/cgroup", "Root of the cgroup filesystem")
+	flag.IntVar(&historySize, "history", 120, "Number of samples of history to retain per device for /history")
 	flag.Parse()
 
 	httpPort = strings.TrimSpace(httpPort)
@@ -49,96 +99,210 @@ func main() {
 	if len(devices) == 0 {
 		devices = "sda"
 	}
+	if historySize <= 0 {
+		historySize = 120
+	}
+	compileDeviceFilters()
+
+	if strings.EqualFold(devices, "auto") {
+		go runDeviceDiscovery(deviceRescan)
+	} else {
+		for _, dev := range strings.Split(devices, ",") {
+			startDevice(dev)
+		}
+	}
+
+	cpuValue := new(atomic.Value)
+	go runCollector("cpu", cpuCollector{}, cpuValue)
 
-	for _, dev := range strings.Split(devices, ",") {
-		value := new(atomic.Value)
-		lastSamples[dev] = value
-		go monitor("/sys/block/"+dev+"/stat", value)
+	memValue := new(atomic.Value)
+	go runCollector("mem", memCollector{}, memValue)
+
+	netValue := new(atomic.Value)
+	go runCollector("net", netCollector{}, netValue)
+
+	if strings.TrimSpace(cgroup) != "" {
+		go startCgroupCollector(cgroup, cgroupRoot)
 	}
 
-	http.HandleFunc("/", statsHandlerAsJSON)
+	http.HandleFunc("/", statsHandlerAsJSON(cpuValue, memValue, netValue))
+	http.HandleFunc("/metrics", statsHandlerAsPrometheus)
+	http.HandleFunc("/stream", streamHandler(hub))
+	http.HandleFunc("/history", historyHandler())
+	http.HandleFunc("/healthz", healthzHandler)
 	http.ListenAndServe(httpPort, http.DefaultServeMux)
 }
 
-func monitor(statFile string, lastSample *atomic.Value) {
-	f, err := os.Open(statFile)
+// diskCollector implements Collector for a single block device, reading its
+// cumulative /sys/block/<dev>/stat counters and deriving per-second rates
+// from the delta since the previous sample.
+type diskCollector struct {
+	device string
+	f      *os.File
+	r      *bufio.Reader
+	prev   [11]int64
+	hist   *latencyHistogram
+}
+
+// newDiskCollector opens device's stat file and takes the baseline reading
+// future samples are differenced against. hist is supplied by the caller
+// (rather than created here) so that a device registered before its first
+// successful open still has a histogram for /metrics to read.
+func newDiskCollector(device string, hist *latencyHistogram) (*diskCollector, error) {
+	f, err := os.Open("/sys/block/" + device + "/stat")
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	defer f.Close()
-
 	r := bufio.NewReader(f)
-	prev := readStat(r)
-	ticker := time.NewTicker(sampleInterval)
-	defer ticker.Stop()
+	prev, err := readStat(r)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &diskCollector{device: device, f: f, r: r, prev: prev, hist: hist}, nil
+}
 
-	for {
-		<-ticker.C
-		_, err := f.Seek(0, 0)
-		if err != nil {
-			panic(err)
-		}
-		r.Reset(f)
-
-		// https://www.kernel.org/doc/Documentation/block/stat.txt defines format:
-		//	   Name            units         description
-		//	   ----            -----         -----------
-		//	 0 read I/Os       requests      number of read I/Os processed
-		//	 1 read merges     requests      number of read I/Os merged with in-queue I/O
-		//	 2 read sectors    sectors       number of sectors read
-		//	 3 read ticks      milliseconds  total wait time for read requests
-		//	 4 write I/Os      requests      number of write I/Os processed
-		//	 5 write merges    requests      number of write I/Os merged with in-queue I/O
-		//	 6 write sectors   sectors       number of sectors written
-		//	 7 write ticks     milliseconds  total wait time for write requests
-		//	 8 in_flight       requests      number of I/Os currently in flight
-		//	 9 io_ticks        milliseconds  total time this block device has been active
-		//	10 time_in_queue   milliseconds  total wait time for all requests
-
-		cur := readStat(r)
-
-		for i := range cur {
-			fmt.Print(cur[i]-prev[i], "\t")
-		}
-		fmt.Println()
-		stats := ioStats{
-			Timestamp:          time.Now(),
-			ReadsPerSec:        (cur[0] - prev[0]) * int64(time.Second) / int64(sampleInterval),
-			BytesReadPerSec:    (cur[2] - prev[2]) * 512 * int64(time.Second) / int64(sampleInterval),
-			ReadMillis:         (cur[3] - prev[3]) * int64(time.Second) / int64(sampleInterval),
-			WritesPerSec:       (cur[4] - prev[4]) * int64(time.Second) / int64(sampleInterval),
-			BytesWrittenPerSec: (cur[6] - prev[6]) * 512 * int64(time.Second) / int64(sampleInterval),
-			WriteMillis:        (cur[7] - prev[7]) * int64(time.Second) / int64(sampleInterval),
-			InFlight:           cur[8],
-			WaitMillis:         (cur[10] - prev[10]) * int64(time.Second) / int64(sampleInterval),
-		}
-		lastSample.Store(stats)
-		prev = cur
+// Close releases the open handle on the device's stat file. It must be
+// called once the collector is no longer in use (e.g. the device has been
+// unplugged), or the fd leaks for the life of the process.
+func (c *diskCollector) Close() error {
+	return c.f.Close()
+}
+
+// https://www.kernel.org/doc/Documentation/block/stat.txt defines format:
+//
+//	   Name            units         description
+//	   ----            -----         -----------
+//	 0 read I/Os       requests      number of read I/Os processed
+//	 1 read merges     requests      number of read I/Os merged with in-queue I/O
+//	 2 read sectors    sectors       number of sectors read
+//	 3 read ticks      milliseconds  total wait time for read requests
+//	 4 write I/Os      requests      number of write I/Os processed
+//	 5 write merges    requests      number of write I/Os merged with in-queue I/O
+//	 6 write sectors   sectors       number of sectors written
+//	 7 write ticks     milliseconds  total wait time for write requests
+//	 8 in_flight       requests      number of I/Os currently in flight
+//	 9 io_ticks        milliseconds  total time this block device has been active
+//	10 time_in_queue   milliseconds  total wait time for all requests
+func (c *diskCollector) Collect() (interface{}, error) {
+	if _, err := c.f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	c.r.Reset(c.f)
+
+	cur, err := readStat(c.r)
+	if err != nil {
+		return nil, fmt.Errorf("disk:%s: %w", c.device, err)
+	}
+	prev := c.prev
+	c.prev = cur
+	now := time.Now()
+
+	var readLatencyMs, writeLatencyMs float64
+	if deltaReads := cur[0] - prev[0]; deltaReads > 0 {
+		readLatencyMs = float64(cur[3]-prev[3]) / float64(deltaReads)
+		c.hist.Observe(now, time.Duration(readLatencyMs*float64(time.Millisecond)))
+	}
+	if deltaWrites := cur[4] - prev[4]; deltaWrites > 0 {
+		writeLatencyMs = float64(cur[7]-prev[7]) / float64(deltaWrites)
+		c.hist.Observe(now, time.Duration(writeLatencyMs*float64(time.Millisecond)))
+	}
+	snap := c.hist.Snapshot(now)
+
+	stats := ioStats{
+		Timestamp:          now,
+		ReadsPerSec:        (cur[0] - prev[0]) * int64(time.Second) / int64(sampleInterval),
+		BytesReadPerSec:    (cur[2] - prev[2]) * 512 * int64(time.Second) / int64(sampleInterval),
+		ReadMillis:         (cur[3] - prev[3]) * int64(time.Second) / int64(sampleInterval),
+		WritesPerSec:       (cur[4] - prev[4]) * int64(time.Second) / int64(sampleInterval),
+		BytesWrittenPerSec: (cur[6] - prev[6]) * 512 * int64(time.Second) / int64(sampleInterval),
+		WriteMillis:        (cur[7] - prev[7]) * int64(time.Second) / int64(sampleInterval),
+		InFlight:           cur[8],
+		WaitMillis:         (cur[10] - prev[10]) * int64(time.Second) / int64(sampleInterval),
+
+		Reads:           cur[0],
+		BytesRead:       cur[2] * 512,
+		ReadTicksMillis: cur[3],
+
+		Writes:           cur[4],
+		BytesWritten:     cur[6] * 512,
+		WriteTicksMillis: cur[7],
 
+		IoTicksMillis:     cur[9],
+		TimeInQueueMillis: cur[10],
+
+		ReadLatencyAvgMillis:  readLatencyMs,
+		WriteLatencyAvgMillis: writeLatencyMs,
+		LatencyP50Millis:      snap.P50.Seconds() * 1000,
+		LatencyP90Millis:      snap.P90.Seconds() * 1000,
+		LatencyP99Millis:      snap.P99.Seconds() * 1000,
+		LatencyMaxMillis:      snap.Max.Seconds() * 1000,
+
+		Healthy: true,
 	}
+	return stats, nil
 }
 
-func readStat(r io.Reader) [11]int64 {
+// readStat parses the first 11 whitespace-separated fields of a block
+// device's /sys/block/<dev>/stat, per
+// https://www.kernel.org/doc/Documentation/block/stat.txt. Newer kernels
+// append further discard and flush fields beyond these 11; readStat
+// simply stops after the fields it knows about rather than erroring.
+func readStat(r io.Reader) ([11]int64, error) {
 	var cur [11]int64
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
 	for i := range cur {
-		if _, err := fmt.Fscanf(r, "%d", &cur[i]); err != nil {
-			// There's a bug in either the kernel or my code. No prizes for guessing which.
-			panic(err)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return cur, err
+			}
+			return cur, fmt.Errorf("short read: expected %d fields, got %d", len(cur), i)
+		}
+		v, err := strconv.ParseInt(scanner.Text(), 10, 64)
+		if err != nil {
+			return cur, fmt.Errorf("parsing field %d: %w", i, err)
 		}
+		cur[i] = v
 	}
-	return cur
+	return cur, nil
 }
 
-func statsHandlerAsJSON(w http.ResponseWriter, r *http.Request) {
-	m := make(map[string]ioStats)
-	for name, value := range lastSamples {
-		s := value.Load()
-		if s != nil {
-			m[name] = s.(ioStats)
+// statsHandlerAsJSON returns a handler reporting the latest sample from
+// every collector, namespaced by resource kind: "disk" keyed by device,
+// "cpu", "mem" and "net" each a single snapshot, and "cgroup" (if enabled)
+// keyed by container ID.
+func statsHandlerAsJSON(cpuValue, memValue, netValue *atomic.Value) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		disk := make(map[string]ioStats)
+		for _, name := range deviceNames() {
+			state, ok := getDeviceState(name)
+			if !ok {
+				continue
+			}
+			if s := state.value.Load(); s != nil {
+				disk[name] = s.(ioStats)
+			}
+		}
+
+		m := map[string]interface{}{
+			"disk": disk,
+		}
+		if s := cpuValue.Load(); s != nil {
+			m["cpu"] = s
+		}
+		if s := memValue.Load(); s != nil {
+			m["mem"] = s
+		}
+		if s := netValue.Load(); s != nil {
+			m["net"] = s
+		}
+		if cg := loadCgroupSamples(); len(cg) > 0 {
+			m["cgroup"] = cg
 		}
-	}
 
-	b, _ := json.Marshal(m)
-	w.Header().Add("Content-Type", "application/json")
-	w.Write(b)
+		b, _ := json.Marshal(m)
+		w.Header().Add("Content-Type", "application/json")
+		w.Write(b)
+	}
 }
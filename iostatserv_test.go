@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadStatTolerates15ColumnFormat(t *testing.T) {
+	// Kernels newer than the 11-field stat.txt append discard and flush
+	// counters; readStat must only look at the first 11 and ignore the rest.
+	r := strings.NewReader("1 2 3 4 5 6 7 8 9 10 11 12 13 14 15\n")
+
+	got, err := readStat(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [11]int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	if got != want {
+		t.Fatalf("readStat() = %v, want %v", got, want)
+	}
+}
+
+func TestReadStatShortReadReturnsError(t *testing.T) {
+	r := strings.NewReader("1 2 3")
+
+	if _, err := readStat(r); err == nil {
+		t.Fatal("readStat() err = nil, want an error for a short read")
+	}
+}
+
+func TestReadStatMalformedFieldReturnsError(t *testing.T) {
+	r := strings.NewReader("1 2 notanumber 4 5 6 7 8 9 10 11\n")
+
+	if _, err := readStat(r); err == nil {
+		t.Fatal("readStat() err = nil, want an error for a non-numeric field")
+	}
+}
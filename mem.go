@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// memCollector implements Collector, reporting every field of
+// /proc/meminfo verbatim, in kB, keyed by its field name (e.g. "MemTotal",
+// "MemAvailable", "Cached"). It holds no state, so a fresh handle is opened
+// on every Collect call.
+type memCollector struct{}
+
+func (memCollector) Collect() (interface{}, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := make(map[string]int64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		result[key] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// metricDescs describes the Prometheus series emitted for each device, in
+// the order they should appear in the exposition output. Each entry's value
+// function is applied to a device's most recent ioStats sample.
+var metricDescs = []struct {
+	name  string
+	help  string
+	mtype string
+	value func(ioStats) int64
+}{
+	{"iostat_reads_total", "Total number of read I/Os processed.", "counter", func(s ioStats) int64 { return s.Reads }},
+	{"iostat_bytes_read_total", "Total number of bytes read.", "counter", func(s ioStats) int64 { return s.BytesRead }},
+	{"iostat_writes_total", "Total number of write I/Os processed.", "counter", func(s ioStats) int64 { return s.Writes }},
+	{"iostat_bytes_written_total", "Total number of bytes written.", "counter", func(s ioStats) int64 { return s.BytesWritten }},
+	{"iostat_read_ticks_ms_total", "Total wait time for read requests, in milliseconds.", "counter", func(s ioStats) int64 { return s.ReadTicksMillis }},
+	{"iostat_write_ticks_ms_total", "Total wait time for write requests, in milliseconds.", "counter", func(s ioStats) int64 { return s.WriteTicksMillis }},
+	{"iostat_io_ticks_ms_total", "Total time this device has been active, in milliseconds.", "counter", func(s ioStats) int64 { return s.IoTicksMillis }},
+	{"iostat_time_in_queue_ms_total", "Total wait time for all requests, in milliseconds.", "counter", func(s ioStats) int64 { return s.TimeInQueueMillis }},
+	{"iostat_in_flight", "Number of I/Os currently in flight.", "gauge", func(s ioStats) int64 { return s.InFlight }},
+}
+
+// statsHandlerAsPrometheus exposes the per-device disk counters and latency
+// histogram in the Prometheus text exposition format, so the server can be
+// scraped directly without an intermediate exporter. The cpu, mem, net and
+// cgroup samples reported by statsHandlerAsJSON are not exported here.
+func statsHandlerAsPrometheus(w http.ResponseWriter, r *http.Request) {
+	names := deviceNames()
+
+	w.Header().Add("Content-Type", "text/plain; version=0.0.4")
+
+	for _, desc := range metricDescs {
+		fmt.Fprintf(w, "# HELP %s %s\n", desc.name, desc.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", desc.name, desc.mtype)
+		for _, name := range names {
+			state, ok := getDeviceState(name)
+			if !ok {
+				continue
+			}
+			v := state.value.Load()
+			if v == nil {
+				continue
+			}
+			s := v.(ioStats)
+			fmt.Fprintf(w, "%s{device=%q} %d\n", desc.name, name, desc.value(s))
+		}
+	}
+
+	writeLatencyHistogram(w, names)
+}
+
+// writeLatencyHistogram emits iostat_latency_seconds as a standard
+// Prometheus histogram: one cumulative _bucket series per device per
+// bound, plus _sum and _count, covering the same latencyHistogramWindow
+// sliding window as the JSON endpoint's quantile fields.
+func writeLatencyHistogram(w http.ResponseWriter, names []string) {
+	const name = "iostat_latency_seconds"
+	fmt.Fprintf(w, "# HELP %s Disk I/O service latency (read_ticks/reads, write_ticks/writes) over a sliding %s window.\n", name, latencyHistogramWindow)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+
+	now := time.Now()
+	for _, devName := range names {
+		state, ok := getDeviceState(devName)
+		if !ok {
+			continue
+		}
+		snap := state.hist.Snapshot(now)
+		for i, bound := range latencyBounds {
+			le := strconv.FormatFloat(time.Duration(bound).Seconds(), 'g', -1, 64)
+			fmt.Fprintf(w, "%s_bucket{device=%q,le=%q} %d\n", name, devName, le, snap.Buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{device=%q,le=\"+Inf\"} %d\n", name, devName, snap.Count)
+		fmt.Fprintf(w, "%s_sum{device=%q} %s\n", name, devName, strconv.FormatFloat(snap.Sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{device=%q} %d\n", name, devName, snap.Count)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatsHandlerAsPrometheusEmitsHelpTypeAndLabelledSamples(t *testing.T) {
+	registerFakeDevice(t, "sda", ioStats{
+		Timestamp: time.Now(),
+		Healthy:   true,
+		Reads:     42,
+		BytesRead: 4096,
+	})
+
+	w := httptest.NewRecorder()
+	statsHandlerAsPrometheus(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	for _, want := range []string{
+		"# HELP iostat_reads_total Total number of read I/Os processed.",
+		"# TYPE iostat_reads_total counter",
+		`iostat_reads_total{device="sda"} 42`,
+		`iostat_bytes_read_total{device="sda"} 4096`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body does not contain %q; full body:\n%s", want, body)
+		}
+	}
+}
+
+func TestWriteLatencyHistogramEmitsBucketsSumAndCount(t *testing.T) {
+	hist := newLatencyHistogram(latencyHistogramWindow)
+	now := time.Now()
+	hist.Observe(now, 2*time.Millisecond)
+	hist.Observe(now, 8*time.Millisecond)
+
+	deviceRegistry.Store("sda", &deviceState{value: new(atomic.Value), hist: hist})
+	t.Cleanup(func() { deviceRegistry.Delete("sda") })
+
+	w := httptest.NewRecorder()
+	writeLatencyHistogram(w, []string{"sda"})
+	body := w.Body.String()
+
+	for _, want := range []string{
+		"# HELP iostat_latency_seconds",
+		"# TYPE iostat_latency_seconds histogram",
+		`iostat_latency_seconds_bucket{device="sda",le="+Inf"} 2`,
+		`iostat_latency_seconds_count{device="sda"} 2`,
+		`iostat_latency_seconds_sum{device="sda"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body does not contain %q; full body:\n%s", want, body)
+		}
+	}
+}
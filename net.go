@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// netStats holds the cumulative counters for one network interface, as
+// reported by /proc/net/dev.
+type netStats struct {
+	Timestamp time.Time
+	RxBytes   int64
+	RxPackets int64
+	RxErrors  int64
+	RxDropped int64
+	TxBytes   int64
+	TxPackets int64
+	TxErrors  int64
+	TxDropped int64
+}
+
+// netCollector implements Collector, reporting per-interface counters from
+// /proc/net/dev. It holds no state, so a fresh handle is opened on every
+// Collect call.
+type netCollector struct{}
+
+func (netCollector) Collect() (interface{}, error) {
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := make(map[string]netStats)
+	now := time.Now()
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if lineNo <= 2 {
+			// First two lines are headers.
+			continue
+		}
+
+		iface, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 16 {
+			continue
+		}
+
+		vals := make([]int64, 16)
+		for i, field := range fields[:16] {
+			v, err := strconv.ParseInt(field, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = v
+		}
+
+		result[strings.TrimSpace(iface)] = netStats{
+			Timestamp: now,
+			RxBytes:   vals[0],
+			RxPackets: vals[1],
+			RxErrors:  vals[2],
+			RxDropped: vals[3],
+			TxBytes:   vals[8],
+			TxPackets: vals[9],
+			TxErrors:  vals[10],
+			TxDropped: vals[11],
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
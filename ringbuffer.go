@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// ringBuffer is a fixed-size, concurrency-safe history of the most recent
+// ioStats samples for one device.
+type ringBuffer struct {
+	mu     sync.Mutex
+	buf    []ioStats
+	size   int
+	next   int
+	filled bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{buf: make([]ioStats, size), size: size}
+}
+
+func (b *ringBuffer) Add(s ioStats) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf[b.next] = s
+	b.next = (b.next + 1) % b.size
+	if b.next == 0 {
+		b.filled = true
+	}
+}
+
+// Since returns the buffered samples with Timestamp after since, oldest
+// first.
+func (b *ringBuffer) Since(since time.Time) []ioStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := b.next
+	if b.filled {
+		n = b.size
+	}
+
+	result := make([]ioStats, 0, n)
+	start := 0
+	if b.filled {
+		start = b.next
+	}
+	for i := 0; i < n; i++ {
+		s := b.buf[(start+i)%b.size]
+		if s.Timestamp.After(since) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
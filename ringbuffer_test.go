@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func sampleAt(sec int64) ioStats {
+	return ioStats{Timestamp: time.Unix(sec, 0)}
+}
+
+func TestRingBufferSinceBeforeWrap(t *testing.T) {
+	b := newRingBuffer(4)
+	b.Add(sampleAt(1))
+	b.Add(sampleAt(2))
+	b.Add(sampleAt(3))
+
+	got := b.Since(time.Unix(0, 0))
+	if len(got) != 3 {
+		t.Fatalf("got %d samples, want 3", len(got))
+	}
+	for i, want := range []int64{1, 2, 3} {
+		if got[i].Timestamp.Unix() != want {
+			t.Errorf("sample %d: got timestamp %d, want %d", i, got[i].Timestamp.Unix(), want)
+		}
+	}
+}
+
+func TestRingBufferWraparoundKeepsOldestFirst(t *testing.T) {
+	b := newRingBuffer(3)
+	for _, sec := range []int64{1, 2, 3, 4, 5} {
+		b.Add(sampleAt(sec))
+	}
+
+	got := b.Since(time.Unix(0, 0))
+	if len(got) != 3 {
+		t.Fatalf("got %d samples, want 3", len(got))
+	}
+	for i, want := range []int64{3, 4, 5} {
+		if got[i].Timestamp.Unix() != want {
+			t.Errorf("sample %d: got timestamp %d, want %d", i, got[i].Timestamp.Unix(), want)
+		}
+	}
+}
+
+func TestRingBufferSinceFiltersOlderSamples(t *testing.T) {
+	b := newRingBuffer(4)
+	for _, sec := range []int64{1, 2, 3, 4} {
+		b.Add(sampleAt(sec))
+	}
+
+	got := b.Since(time.Unix(2, 0))
+	if len(got) != 2 {
+		t.Fatalf("got %d samples, want 2", len(got))
+	}
+	if got[0].Timestamp.Unix() != 3 || got[1].Timestamp.Unix() != 4 {
+		t.Errorf("got timestamps %d, %d; want 3, 4", got[0].Timestamp.Unix(), got[1].Timestamp.Unix())
+	}
+}
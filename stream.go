@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// streamEvent is the JSON payload pushed to /stream subscribers and
+// returned by /history: a sample tagged with the device it came from.
+type streamEvent struct {
+	Device string `json:"device"`
+	ioStats
+}
+
+// streamHub fans out each new disk sample to every subscriber of its
+// device, alongside the single atomic.Value that holds the latest sample
+// for the JSON and Prometheus endpoints.
+type streamHub struct {
+	subscribe   chan subscription
+	unsubscribe chan subscription
+	publish     chan streamEvent
+}
+
+type subscription struct {
+	device string
+	ch     chan streamEvent
+}
+
+func newStreamHub() *streamHub {
+	h := &streamHub{
+		subscribe:   make(chan subscription),
+		unsubscribe: make(chan subscription),
+		publish:     make(chan streamEvent),
+	}
+	go h.run()
+	return h
+}
+
+func (h *streamHub) run() {
+	subscribers := make(map[string]map[chan streamEvent]struct{})
+	for {
+		select {
+		case s := <-h.subscribe:
+			if subscribers[s.device] == nil {
+				subscribers[s.device] = make(map[chan streamEvent]struct{})
+			}
+			subscribers[s.device][s.ch] = struct{}{}
+		case s := <-h.unsubscribe:
+			delete(subscribers[s.device], s.ch)
+		case e := <-h.publish:
+			for ch := range subscribers[e.Device] {
+				select {
+				case ch <- e:
+				default:
+					// Subscriber is too slow; drop the sample rather than
+					// block the collector.
+				}
+			}
+			for ch := range subscribers[""] {
+				select {
+				case ch <- e:
+				default:
+				}
+			}
+		}
+	}
+}
+
+func (h *streamHub) Publish(e streamEvent) {
+	h.publish <- e
+}
+
+func (h *streamHub) Subscribe(device string) chan streamEvent {
+	ch := make(chan streamEvent, 16)
+	h.subscribe <- subscription{device: device, ch: ch}
+	return ch
+}
+
+func (h *streamHub) Unsubscribe(device string, ch chan streamEvent) {
+	h.unsubscribe <- subscription{device: device, ch: ch}
+}
+
+// runDiskCollector is runCollector's disk-specific counterpart: as well as
+// storing each sample for the plain JSON and Prometheus endpoints, it
+// appends to the device's history ring buffer and publishes to the stream
+// hub so /stream and /history stay live without polling. It returns when
+// ctx is cancelled, which happens when the device disappears under
+// -devices auto.
+func runDiskCollector(ctx context.Context, device string, dc *diskCollector, store *atomic.Value, buf *ringBuffer, hub *streamHub) {
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	defer dc.Close()
+
+	var last ioStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			v, err := dc.Collect()
+			if err != nil {
+				log.Printf("%v", err)
+				last.Healthy = false
+				last.LastError = err.Error()
+				store.Store(last)
+				continue
+			}
+			s := v.(ioStats)
+			last = s
+			store.Store(s)
+			buf.Add(s)
+			hub.Publish(streamEvent{Device: device, ioStats: s})
+		}
+	}
+}
+
+// streamHandler serves /stream. By default it pushes samples as
+// Server-Sent Events; a client that sends the WebSocket upgrade headers is
+// switched to a WebSocket connection instead. An optional ?device= query
+// parameter restricts the stream to one device.
+func streamHandler(hub *streamHub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device := r.URL.Query().Get("device")
+		ch := hub.Subscribe(device)
+		defer hub.Unsubscribe(device, ch)
+
+		if r.Header.Get("Upgrade") == "websocket" {
+			serveWebSocketStream(w, r, ch)
+			return
+		}
+		serveSSEStream(w, r, ch)
+	}
+}
+
+func serveSSEStream(w http.ResponseWriter, r *http.Request, ch chan streamEvent) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case e := <-ch:
+			b, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", b)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+const websocketAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// serveWebSocketStream performs a minimal RFC 6455 handshake and then
+// writes each sample as a text frame. It is write-only: once upgraded, the
+// connection is used purely to push samples, so incoming frames are not
+// parsed, only drained to notice when the client disconnects.
+func serveWebSocketStream(w http.ResponseWriter, r *http.Request, ch chan streamEvent) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+	accept := base64.StdEncoding.EncodeToString(sha1Sum(key + websocketAcceptGUID))
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket unsupported", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(buf, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", accept)
+	buf.Flush()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		// We don't act on client frames, just notice disconnection.
+		discard := make([]byte, 512)
+		for {
+			if _, err := buf.Reader.Read(discard); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case e := <-ch:
+			b, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if err := writeWebSocketTextFrame(buf.Writer, b); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// writeWebSocketTextFrame writes payload as a single, unmasked, final text
+// frame (opcode 0x1), per RFC 6455 section 5.2. Servers never mask frames.
+func writeWebSocketTextFrame(w *bufio.Writer, payload []byte) error {
+	header := []byte{0x81} // FIN=1, opcode=1 (text)
+
+	n := len(payload)
+	switch {
+	case n <= 125:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		var lenBytes [2]byte
+		binary.BigEndian.PutUint16(lenBytes[:], uint16(n))
+		header = append(header, lenBytes[:]...)
+	default:
+		header = append(header, 127)
+		var lenBytes [8]byte
+		binary.BigEndian.PutUint64(lenBytes[:], uint64(n))
+		header = append(header, lenBytes[:]...)
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func sha1Sum(s string) []byte {
+	h := sha1.Sum([]byte(s))
+	return h[:]
+}
+
+// historyHandler serves /history?device=sda&since=<RFC3339>, returning the
+// buffered samples for device newer than since (or the whole buffer if
+// since is omitted) so a client can backfill before subscribing to
+// /stream.
+func historyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device := r.URL.Query().Get("device")
+		state, ok := getDeviceState(device)
+		if !ok {
+			http.Error(w, "unknown device", http.StatusNotFound)
+			return
+		}
+		buf := state.history
+
+		since := time.Time{}
+		if s := r.URL.Query().Get("since"); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			since = t
+		}
+
+		samples := buf.Since(since)
+		events := make([]streamEvent, len(samples))
+		for i, s := range samples {
+			events[i] = streamEvent{Device: device, ioStats: s}
+		}
+
+		b, _ := json.Marshal(events)
+		w.Header().Add("Content-Type", "application/json")
+		w.Write(b)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func writeFrame(t *testing.T, payload []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := writeWebSocketTextFrame(w, payload); err != nil {
+		t.Fatalf("writeWebSocketTextFrame: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteWebSocketTextFrameShortPayload(t *testing.T) {
+	payload := []byte("hello")
+	frame := writeFrame(t, payload)
+
+	if frame[0] != 0x81 {
+		t.Fatalf("first byte = %#x, want FIN+text opcode 0x81", frame[0])
+	}
+	if frame[1] != byte(len(payload)) {
+		t.Fatalf("length byte = %d, want %d", frame[1], len(payload))
+	}
+	if !bytes.Equal(frame[2:], payload) {
+		t.Fatalf("payload = %q, want %q", frame[2:], payload)
+	}
+}
+
+func TestWriteWebSocketTextFrameMediumPayload(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 200)
+	frame := writeFrame(t, payload)
+
+	if frame[1] != 126 {
+		t.Fatalf("length byte = %d, want 126 (16-bit length follows)", frame[1])
+	}
+	gotLen := int(frame[2])<<8 | int(frame[3])
+	if gotLen != len(payload) {
+		t.Fatalf("encoded length = %d, want %d", gotLen, len(payload))
+	}
+	if !bytes.Equal(frame[4:], payload) {
+		t.Fatalf("payload mismatch")
+	}
+}
+
+// Servers must never mask frames sent to clients (RFC 6455 section 5.1).
+func TestWriteWebSocketTextFrameNeverSetsMaskBit(t *testing.T) {
+	frame := writeFrame(t, []byte("unmasked"))
+	if frame[1]&0x80 != 0 {
+		t.Fatalf("mask bit set in length byte %#x; servers must not mask frames", frame[1])
+	}
+}